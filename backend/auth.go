@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User roles, from least to most privileged.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// roleRank lets requireRole treat higher roles as satisfying a lower
+// requirement (an admin can do anything an operator can).
+var roleRank = map[string]int{
+	RoleViewer:   0,
+	RoleOperator: 1,
+	RoleAdmin:    2,
+}
+
+type User struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type registerRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type authClaims struct {
+	UserID int    `json:"userId"`
+	Role   string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+const authCookieName = "auth_token"
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+func jwtSecret() []byte {
+	return []byte(getEnv("JWT_SECRET", "dev-secret-change-me"))
+}
+
+// canProvisionRole reports whether the caller may register a user with a
+// role above viewer: either they're already an authenticated admin
+// provisioning another account, or the users table is empty and this is the
+// one-time bootstrap of the very first account.
+func canProvisionRole(r *http.Request) (bool, error) {
+	if user := userFromContext(r); user != nil && user.Role == RoleAdmin {
+		return true, nil
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// register creates a new user account. Anyone can self-register as a
+// viewer; provisioning an operator or admin account requires either an
+// existing admin session or an empty users table (bootstrapping the very
+// first account).
+func register(w http.ResponseWriter, r *http.Request) {
+	var req registerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error decoding register JSON: %v", err)
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+
+	if req.Email == "" || req.Password == "" {
+		sendErrorResponse(w, http.StatusBadRequest, "Email and password are required")
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = RoleViewer
+	}
+	if _, ok := roleRank[req.Role]; !ok {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid role")
+		return
+	}
+
+	if req.Role != RoleViewer {
+		allowed, err := canProvisionRole(r)
+		if err != nil {
+			log.Printf("Error checking role provisioning eligibility: %v", err)
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to verify registration eligibility")
+			return
+		}
+		if !allowed {
+			sendErrorResponse(w, http.StatusForbidden, "Only an existing admin can provision operator/admin accounts")
+			return
+		}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+
+	var user User
+	err = db.QueryRow(
+		`INSERT INTO users (email, password_hash, role) VALUES ($1, $2, $3) RETURNING id, email, role, created_at`,
+		req.Email, string(hash), req.Role,
+	).Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			sendErrorResponse(w, http.StatusConflict, "Email already registered")
+			return
+		}
+		log.Printf("Error creating user: %v", err)
+		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create user: %v", err))
+		return
+	}
+
+	log.Printf("User registered: %s (id=%d, role=%s)", user.Email, user.ID, user.Role)
+
+	sendJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "User registered successfully",
+		Data:    user,
+	})
+}
+
+// login verifies credentials and sets an HTTP-only cookie containing a
+// signed JWT.
+func login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error decoding login JSON: %v", err)
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+
+	var user User
+	var passwordHash string
+	err := db.QueryRow(
+		`SELECT id, email, role, password_hash, created_at FROM users WHERE email = $1`,
+		req.Email,
+	).Scan(&user.ID, &user.Email, &user.Role, &passwordHash, &user.CreatedAt)
+	if err != nil {
+		sendErrorResponse(w, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		sendErrorResponse(w, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+
+	token, err := issueToken(user)
+	if err != nil {
+		log.Printf("Error issuing token for user %d: %v", user.ID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Now().Add(24 * time.Hour),
+	})
+
+	log.Printf("User logged in: %s (id=%d)", user.Email, user.ID)
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Login successful",
+		Data:    user,
+	})
+}
+
+func issueToken(user User) (string, error) {
+	claims := authClaims{
+		UserID: user.ID,
+		Role:   user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret())
+}
+
+// authMiddleware parses the auth cookie, loads the user, and stores it in
+// the request context. It does not itself reject unauthenticated requests;
+// requireRole does that so public endpoints (if any) can stay reachable.
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(authCookieName)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var claims authClaims
+		_, err = jwt.ParseWithClaims(cookie.Value, &claims, func(t *jwt.Token) (interface{}, error) {
+			return jwtSecret(), nil
+		})
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var user User
+		err = db.QueryRow(`SELECT id, email, role, created_at FROM users WHERE id = $1`, claims.UserID).
+			Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, &user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func userFromContext(r *http.Request) *User {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	return user
+}
+
+// checkClipOwnership ensures the caller owns the resource tied to ownerID
+// unless they're an admin, so clip-scoped endpoints can't be reached for
+// another tenant's footage just by guessing a sequential ID.
+func checkClipOwnership(r *http.Request, ownerID int) *AppError {
+	user := userFromContext(r)
+	if user == nil {
+		return newAppError("UNAUTHORIZED", nil)
+	}
+	if user.Role == RoleAdmin || user.ID == ownerID {
+		return nil
+	}
+	return newAppError("FORBIDDEN", nil)
+}
+
+// requireRole wraps a handler so it 401s with no authenticated user and 403s
+// if that user's role doesn't meet the minimum required rank.
+func requireRole(minRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromContext(r)
+		if user == nil {
+			sendErrorResponse(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		if roleRank[user.Role] < roleRank[minRole] {
+			sendErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// contentAddressedPath returns where a clip blob with the given sha256 hex
+// digest should live, sharded two levels deep so no single directory ends up
+// with millions of entries.
+func contentAddressedPath(config *Config, hash, ext string) string {
+	return filepath.Join(config.UploadDir, "clips", hash[0:2], hash[2:4], hash+ext)
+}
+
+// findClipByContentHash returns the clip that already owns this content
+// hash, if any, so callers can dedup instead of storing the same bytes
+// twice. The lookup is scoped to the requesting user's own clips (admins
+// see across all owners) so a caller can't use the dedup check to learn
+// about, or get handed, another tenant's clip record.
+func findClipByContentHash(hash string, user *User) (*Clip, error) {
+	query := `SELECT id, booking_hour_id, filename, file_path, file_size, mime_type,
+	                 duration_seconds, camera_name, upload_status, owner_id, content_hash, created_at, updated_at
+	          FROM clips WHERE content_hash = $1`
+	args := []interface{}{hash}
+	if user.Role != RoleAdmin {
+		query += " AND owner_id = $2"
+		args = append(args, user.ID)
+	}
+
+	var clip Clip
+	err := db.QueryRow(query, args...).Scan(&clip.ID, &clip.BookingHourID, &clip.Filename, &clip.FilePath, &clip.FileSize, &clip.MimeType,
+		&clip.Duration, &clip.CameraName, &clip.UploadStatus, &clip.OwnerID, &clip.ContentHash, &clip.CreatedAt, &clip.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &clip, nil
+}
+
+// getClipVerify re-hashes the clip's file on disk and reports whether it
+// still matches the content_hash recorded at upload time.
+func getClipVerify(w http.ResponseWriter, r *http.Request) {
+	clipID, err := clipIDFromRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid clip ID")
+		return
+	}
+
+	var filePath string
+	var contentHash *string
+	var ownerID int
+	err = db.QueryRow("SELECT file_path, content_hash, owner_id FROM clips WHERE id = $1", clipID).Scan(&filePath, &contentHash, &ownerID)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, http.StatusNotFound, "Clip not found")
+		return
+	} else if err != nil {
+		log.Printf("Error loading clip %d for verification: %v", clipID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to load clip")
+		return
+	}
+
+	if appErr := checkClipOwnership(r, ownerID); appErr != nil {
+		sendAppError(w, appErr)
+		return
+	}
+
+	if contentHash == nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Clip has no recorded content hash to verify against")
+		return
+	}
+
+	if _, err := os.Stat(filePath); err != nil {
+		sendJSONResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Clip file is missing from disk",
+			Data: map[string]interface{}{
+				"clipId": clipID,
+				"match":  false,
+				"error":  "file not found",
+			},
+		})
+		return
+	}
+
+	actualHash, err := hashFile(filePath)
+	if err != nil {
+		log.Printf("Error hashing clip %d for verification: %v", clipID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to verify clip")
+		return
+	}
+
+	match := actualHash == *contentHash
+	message := "Clip integrity verified"
+	if !match {
+		message = "Clip content hash mismatch"
+		log.Printf("Integrity check failed for clip %d: expected %s, got %s", clipID, *contentHash, actualHash)
+	}
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data: map[string]interface{}{
+			"clipId":       clipID,
+			"match":        match,
+			"expectedHash": *contentHash,
+			"actualHash":   actualHash,
+		},
+	})
+}
+
+func sendDuplicateClipResponse(w http.ResponseWriter, existing *Clip) {
+	appErr := newAppError("CLIP_DUPLICATE", map[string]interface{}{"existingClipId": existing.ID})
+	appErr.Message = fmt.Sprintf("Duplicate content: clip %d already has this footage", existing.ID)
+	sendJSONResponse(w, appErr.HTTPStatus, APIResponse{
+		Success: false,
+		Error:   appErr,
+		Data:    existing,
+	})
+}
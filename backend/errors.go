@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// AppError is a typed, client-distinguishable error: a stable Code clients
+// can branch on, the HTTPStatus to respond with, a human-readable Message,
+// and optional Details for extra context (e.g. which field failed).
+type AppError struct {
+	Code       string                 `json:"code"`
+	HTTPStatus int                    `json:"-"`
+	Message    string                 `json:"message"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+func (e *AppError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// errorRegistry is the set of well-known error codes handlers can raise.
+// Keeping them in one place lets clients branch on Code instead of parsing
+// Message strings, and lets operators build dashboards grouped by Code.
+var errorRegistry = map[string]AppError{
+	"VALIDATION_FAILED":      {Code: "VALIDATION_FAILED", HTTPStatus: http.StatusBadRequest, Message: "Request failed validation"},
+	"COURT_NOT_FOUND":        {Code: "COURT_NOT_FOUND", HTTPStatus: http.StatusBadRequest, Message: "Court not found or inactive"},
+	"COURT_DUPLICATE":        {Code: "COURT_DUPLICATE", HTTPStatus: http.StatusConflict, Message: "Court with this name already exists"},
+	"BOOKING_HOUR_NOT_FOUND": {Code: "BOOKING_HOUR_NOT_FOUND", HTTPStatus: http.StatusBadRequest, Message: "Booking hour not found"},
+	"CLIP_DUPLICATE":         {Code: "CLIP_DUPLICATE", HTTPStatus: http.StatusConflict, Message: "Duplicate content: this footage has already been uploaded"},
+	"UPLOAD_TOO_LARGE":       {Code: "UPLOAD_TOO_LARGE", HTTPStatus: http.StatusBadRequest, Message: "Chunk would exceed declared totalSize"},
+	"UNAUTHORIZED":           {Code: "UNAUTHORIZED", HTTPStatus: http.StatusUnauthorized, Message: "Authentication required"},
+	"FORBIDDEN":              {Code: "FORBIDDEN", HTTPStatus: http.StatusForbidden, Message: "You do not have permission to perform this action"},
+	"NOT_FOUND":              {Code: "NOT_FOUND", HTTPStatus: http.StatusNotFound, Message: "Resource not found"},
+	"DB_UNAVAILABLE":         {Code: "DB_UNAVAILABLE", HTTPStatus: http.StatusInternalServerError, Message: "A database operation failed"},
+	"INTERNAL_ERROR":         {Code: "INTERNAL_ERROR", HTTPStatus: http.StatusInternalServerError, Message: "An internal error occurred"},
+}
+
+// newAppError looks up a registered code and attaches optional details. It
+// falls back to INTERNAL_ERROR for an unregistered code, since that only
+// happens from a programming mistake rather than a runtime condition.
+func newAppError(code string, details map[string]interface{}) *AppError {
+	tmpl, ok := errorRegistry[code]
+	if !ok {
+		log.Printf("newAppError: unregistered error code %q, falling back to INTERNAL_ERROR", code)
+		tmpl = errorRegistry["INTERNAL_ERROR"]
+	}
+	err := tmpl
+	err.Details = details
+	return &err
+}
+
+// dbError wraps an unexpected database error as DB_UNAVAILABLE. Callers are
+// expected to log.Printf the raw err themselves for operators; it must never
+// end up in the client-facing Details, since it can carry constraint names,
+// query fragments, or other internals a caller (including a low-privilege
+// viewer) has no business seeing.
+func dbError(err error) *AppError {
+	return newAppError("DB_UNAVAILABLE", nil)
+}
+
+// sendAppError writes the structured error envelope for the response.
+func sendAppError(w http.ResponseWriter, err *AppError) {
+	sendJSONResponse(w, err.HTTPStatus, APIResponse{
+		Success: false,
+		Error:   err,
+	})
+}
+
+// handle centralizes the error-to-response translation for a handler so
+// individual handlers can just `return err` instead of each calling
+// sendErrorResponse/sendAppError inline. Errors are logged with their code
+// as a field so operators can build dashboards by error class.
+func handle(fn func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := fn(w, r)
+		if err == nil {
+			return
+		}
+
+		appErr, ok := err.(*AppError)
+		if !ok {
+			appErr = newAppError("INTERNAL_ERROR", map[string]interface{}{"cause": err.Error()})
+		}
+
+		log.Printf("code=%s status=%d path=%s error=%q", appErr.Code, appErr.HTTPStatus, r.URL.Path, appErr.Message)
+		sendAppError(w, appErr)
+	}
+}
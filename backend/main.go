@@ -1,7 +1,9 @@
 package main
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -38,6 +40,7 @@ type BookingHour struct {
 	DateStart time.Time `json:"dateStart"`
 	DateEnd   time.Time `json:"dateEnd"`
 	Status    string    `json:"status"`
+	OwnerID   int       `json:"ownerId"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -52,6 +55,8 @@ type Clip struct {
 	Duration      *int      `json:"duration_seconds"`
 	CameraName    *string   `json:"camera_name"`
 	UploadStatus  string    `json:"upload_status"`
+	OwnerID       int       `json:"ownerId"`
+	ContentHash   *string   `json:"content_hash"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
@@ -59,30 +64,39 @@ type Clip struct {
 // Response wrapper
 type APIResponse struct {
 	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   *AppError   `json:"error,omitempty"`
 }
 
 // Configuration
 type Config struct {
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	ServerPort string
-	UploadDir  string
+	DBHost              string
+	DBPort              string
+	DBUser              string
+	DBPassword          string
+	DBName              string
+	ServerPort          string
+	UploadDir           string
+	UploadSessionMaxAge time.Duration
+	UploadSweepInterval time.Duration
+	PackagingWorkers    int
+	AllowedOrigins      []string
 }
 
 func loadConfig() *Config {
 	return &Config{
-		DBHost:     getEnv("DB_HOST", "localhost"),
-		DBPort:     getEnv("DB_PORT", "5432"),
-		DBUser:     getEnv("DB_USER", "postgres"),
-		DBPassword: getEnv("DB_PASSWORD", "password"),
-		DBName:     getEnv("DB_NAME", "cctv_system"),
-		ServerPort: getEnv("SERVER_PORT", "5009"),
-		UploadDir:  getEnv("UPLOAD_DIR", "./uploads"),
+		DBHost:              getEnv("DB_HOST", "localhost"),
+		DBPort:              getEnv("DB_PORT", "5432"),
+		DBUser:              getEnv("DB_USER", "postgres"),
+		DBPassword:          getEnv("DB_PASSWORD", "password"),
+		DBName:              getEnv("DB_NAME", "cctv_system"),
+		ServerPort:          getEnv("SERVER_PORT", "5009"),
+		UploadDir:           getEnv("UPLOAD_DIR", "./uploads"),
+		UploadSessionMaxAge: time.Duration(getEnvInt("UPLOAD_SESSION_MAX_AGE_HOURS", 24)) * time.Hour,
+		UploadSweepInterval: time.Duration(getEnvInt("UPLOAD_SWEEP_INTERVAL_MINUTES", 30)) * time.Minute,
+		PackagingWorkers:    getEnvInt("PACKAGING_WORKERS", 2),
+		AllowedOrigins:      strings.Split(getEnv("ALLOWED_ORIGINS", "http://localhost:3000"), ","),
 	}
 }
 
@@ -93,6 +107,16 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid integer value for %s, using default %d", key, defaultValue)
+	}
+	return defaultValue
+}
+
 // Database initialization with retries
 func initDatabase(config *Config) {
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
@@ -120,12 +144,12 @@ func initDatabase(config *Config) {
 
 		// Connection successful
 		log.Println("Database connected successfully")
-		
+
 		// Set connection pool settings
 		db.SetMaxOpenConns(25)
 		db.SetMaxIdleConns(5)
 		db.SetConnMaxLifetime(5 * time.Minute)
-		
+
 		return
 	}
 
@@ -141,48 +165,93 @@ func sendJSONResponse(w http.ResponseWriter, statusCode int, response APIRespons
 	}
 }
 
+// sendErrorResponse is a convenience for call sites that don't have a more
+// specific AppError code to raise; it buckets the message under a generic
+// code derived from statusCode so every failure still goes through the
+// structured Error envelope.
 func sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
-	sendJSONResponse(w, statusCode, APIResponse{
-		Success: false,
-		Message: message,
-		Data:    nil,
+	sendAppError(w, &AppError{
+		Code:       genericCodeForStatus(statusCode),
+		HTTPStatus: statusCode,
+		Message:    message,
 	})
 }
 
+func genericCodeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "VALIDATION_FAILED"
+	case http.StatusUnauthorized:
+		return "UNAUTHORIZED"
+	case http.StatusForbidden:
+		return "FORBIDDEN"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusConflict:
+		return "CONFLICT"
+	case http.StatusInternalServerError:
+		return "INTERNAL_ERROR"
+	default:
+		return "ERROR"
+	}
+}
+
 // Logging middleware
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		log.Printf("Started %s %s", r.Method, r.URL.Path)
-		
+
 		next.ServeHTTP(w, r)
-		
+
 		log.Printf("Completed %s %s in %v", r.Method, r.URL.Path, time.Since(start))
 	})
 }
 
+var courtSortColumns = map[string]bool{"created_at": true, "name": true}
+
 // Court handlers
-func getCourts(w http.ResponseWriter, r *http.Request) {
+func getCourts(w http.ResponseWriter, r *http.Request) error {
 	nameFilter := r.URL.Query().Get("name")
 	log.Printf("Getting courts with name filter: '%s'", nameFilter)
-	
-	var query string
+
+	page, pageSize, err := parsePageParams(r)
+	if err != nil {
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"cause": err.Error()})
+	}
+	sortCol, order, err := parseSortParams(r, courtSortColumns, "created_at", "desc")
+	if err != nil {
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"cause": err.Error()})
+	}
+
+	conditions := []string{"is_active = true"}
 	var args []interface{}
-	
+
 	if nameFilter != "" {
-		query = "SELECT id, name, description, is_active, created_at, updated_at FROM courts WHERE name ILIKE $1 AND is_active = true"
 		args = append(args, "%"+nameFilter+"%")
-	} else {
-		query = "SELECT id, name, description, is_active, created_at, updated_at FROM courts WHERE is_active = true"
+		conditions = append(conditions, fmt.Sprintf("name ILIKE $%d", len(args)))
 	}
 
+	whereClause := " WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM courts"+whereClause, args...).Scan(&total); err != nil {
+		log.Printf("Error counting courts: %v", err)
+		return dbError(err)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT id, name, description, is_active, created_at, updated_at FROM courts%s ORDER BY %s %s LIMIT $%d OFFSET $%d",
+		whereClause, sortCol, order, len(args)+1, len(args)+2,
+	)
+	args = append(args, pageSize, (page-1)*pageSize)
+
 	log.Printf("Executing query: %s with args: %v", query, args)
 
 	rows, err := db.Query(query, args...)
 	if err != nil {
 		log.Printf("Error querying courts: %v", err)
-		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch courts: %v", err))
-		return
+		return dbError(err)
 	}
 	defer rows.Close()
 
@@ -192,8 +261,7 @@ func getCourts(w http.ResponseWriter, r *http.Request) {
 		err := rows.Scan(&court.ID, &court.Name, &court.Description, &court.IsActive, &court.CreatedAt, &court.UpdatedAt)
 		if err != nil {
 			log.Printf("Error scanning court: %v", err)
-			sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Error scanning court data: %v", err))
-			return
+			return dbError(err)
 		}
 		courts = append(courts, court)
 	}
@@ -201,36 +269,31 @@ func getCourts(w http.ResponseWriter, r *http.Request) {
 	// Check for row iteration errors
 	if err = rows.Err(); err != nil {
 		log.Printf("Error iterating over court rows: %v", err)
-		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Error processing court data: %v", err))
-		return
+		return dbError(err)
 	}
 
-	log.Printf("Found %d courts", len(courts))
+	log.Printf("Found %d courts (page %d of %d total)", len(courts), page, total)
 
-	if len(courts) == 0 && nameFilter != "" {
-		log.Printf("No courts found with name filter: %s", nameFilter)
-		sendErrorResponse(w, http.StatusNotFound, "Court not found")
-		return
-	}
+	hasMore := page*pageSize < total
+	setPaginationLinkHeader(w, r, page, pageSize, hasMore)
 
 	sendJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
 		Message: fmt.Sprintf("Courts retrieved successfully (%d found)", len(courts)),
-		Data:    courts,
+		Data:    PagedData{Items: courts, Page: page, PageSize: pageSize, Total: total, HasMore: hasMore},
 	})
+	return nil
 }
 
-func createCourt(w http.ResponseWriter, r *http.Request) {
+func createCourt(w http.ResponseWriter, r *http.Request) error {
 	var court Court
 	if err := json.NewDecoder(r.Body).Decode(&court); err != nil {
 		log.Printf("Error decoding court JSON: %v", err)
-		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload")
-		return
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"cause": "invalid JSON payload"})
 	}
 
 	if court.Name == "" {
-		sendErrorResponse(w, http.StatusBadRequest, "Court name is required")
-		return
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"field": "name", "cause": "court name is required"})
 	}
 
 	log.Printf("Creating court: %s", court.Name)
@@ -240,56 +303,99 @@ func createCourt(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
 			log.Printf("Court with name '%s' already exists", court.Name)
-			sendErrorResponse(w, http.StatusConflict, "Court with this name already exists")
-			return
+			return newAppError("COURT_DUPLICATE", map[string]interface{}{"name": court.Name})
 		}
 		log.Printf("Error creating court: %v", err)
-		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create court: %v", err))
-		return
+		return dbError(err)
 	}
 
 	court.IsActive = true
 	log.Printf("Court created successfully with ID: %d", court.ID)
-	
+
 	sendJSONResponse(w, http.StatusCreated, APIResponse{
 		Success: true,
 		Message: "Court created successfully",
 		Data:    court,
 	})
+	return nil
 }
 
+var bookingHourSortColumns = map[string]bool{"created_at": true, "date_start": true}
+
 // Booking hour handlers
-func getBookingHours(w http.ResponseWriter, r *http.Request) {
+func getBookingHours(w http.ResponseWriter, r *http.Request) error {
 	courtIDStr := r.URL.Query().Get("courtId")
 	log.Printf("Getting booking hours with court ID filter: '%s'", courtIDStr)
-	
-	var query string
+
+	user := userFromContext(r)
+
+	page, pageSize, err := parsePageParams(r)
+	if err != nil {
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"cause": err.Error()})
+	}
+	sortCol, order, err := parseSortParams(r, bookingHourSortColumns, "date_start", "desc")
+	if err != nil {
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"cause": err.Error()})
+	}
+	from, to, err := parseTimeRangeParams(r)
+	if err != nil {
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"cause": err.Error()})
+	}
+
+	conditions := []string{}
 	var args []interface{}
-	
+
 	if courtIDStr != "" {
 		courtID, err := strconv.Atoi(courtIDStr)
 		if err != nil {
-			sendErrorResponse(w, http.StatusBadRequest, "Invalid court ID")
-			return
+			return newAppError("VALIDATION_FAILED", map[string]interface{}{"field": "courtId", "cause": "invalid court ID"})
 		}
-		query = "SELECT id, court_id, date_start, date_end, status, created_at, updated_at FROM booking_hours WHERE court_id = $1 ORDER BY date_start DESC"
 		args = append(args, courtID)
-	} else {
-		query = "SELECT id, court_id, date_start, date_end, status, created_at, updated_at FROM booking_hours ORDER BY date_start DESC"
+		conditions = append(conditions, fmt.Sprintf("court_id = $%d", len(args)))
 	}
 
+	if user.Role != RoleAdmin {
+		args = append(args, user.ID)
+		conditions = append(conditions, fmt.Sprintf("owner_id = $%d", len(args)))
+	}
+
+	if from != nil {
+		args = append(args, *from)
+		conditions = append(conditions, fmt.Sprintf("date_start >= $%d", len(args)))
+	}
+	if to != nil {
+		args = append(args, *to)
+		conditions = append(conditions, fmt.Sprintf("date_start <= $%d", len(args)))
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM booking_hours"+whereClause, args...).Scan(&total); err != nil {
+		log.Printf("Error counting booking hours: %v", err)
+		return dbError(err)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT id, court_id, date_start, date_end, status, owner_id, created_at, updated_at FROM booking_hours%s ORDER BY %s %s LIMIT $%d OFFSET $%d",
+		whereClause, sortCol, order, len(args)+1, len(args)+2,
+	)
+	args = append(args, pageSize, (page-1)*pageSize)
+
 	rows, err := db.Query(query, args...)
 	if err != nil {
 		log.Printf("Error querying booking hours: %v", err)
-		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch booking hours: %v", err))
-		return
+		return dbError(err)
 	}
 	defer rows.Close()
 
 	var bookingHours []BookingHour
 	for rows.Next() {
 		var bh BookingHour
-		err := rows.Scan(&bh.ID, &bh.CourtID, &bh.DateStart, &bh.DateEnd, &bh.Status, &bh.CreatedAt, &bh.UpdatedAt)
+		err := rows.Scan(&bh.ID, &bh.CourtID, &bh.DateStart, &bh.DateEnd, &bh.Status, &bh.OwnerID, &bh.CreatedAt, &bh.UpdatedAt)
 		if err != nil {
 			log.Printf("Error scanning booking hour: %v", err)
 			continue
@@ -297,31 +403,32 @@ func getBookingHours(w http.ResponseWriter, r *http.Request) {
 		bookingHours = append(bookingHours, bh)
 	}
 
-	log.Printf("Found %d booking hours", len(bookingHours))
+	log.Printf("Found %d booking hours (page %d of %d total)", len(bookingHours), page, total)
+
+	hasMore := page*pageSize < total
+	setPaginationLinkHeader(w, r, page, pageSize, hasMore)
 
 	sendJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
 		Message: fmt.Sprintf("Booking hours retrieved successfully (%d found)", len(bookingHours)),
-		Data:    bookingHours,
+		Data:    PagedData{Items: bookingHours, Page: page, PageSize: pageSize, Total: total, HasMore: hasMore},
 	})
+	return nil
 }
 
-func createBookingHour(w http.ResponseWriter, r *http.Request) {
+func createBookingHour(w http.ResponseWriter, r *http.Request) error {
 	var bh BookingHour
 	if err := json.NewDecoder(r.Body).Decode(&bh); err != nil {
 		log.Printf("Error decoding booking hour JSON: %v", err)
-		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload")
-		return
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"cause": "invalid JSON payload"})
 	}
 
 	if bh.CourtID == 0 {
-		sendErrorResponse(w, http.StatusBadRequest, "Court ID is required")
-		return
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"field": "courtId", "cause": "court ID is required"})
 	}
 
 	if bh.DateStart.IsZero() || bh.DateEnd.IsZero() {
-		sendErrorResponse(w, http.StatusBadRequest, "Date start and date end are required")
-		return
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"cause": "date start and date end are required"})
 	}
 
 	log.Printf("Creating booking hour for court %d from %v to %v", bh.CourtID, bh.DateStart, bh.DateEnd)
@@ -331,25 +438,24 @@ func createBookingHour(w http.ResponseWriter, r *http.Request) {
 	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM courts WHERE id = $1 AND is_active = true)", bh.CourtID).Scan(&exists)
 	if err != nil {
 		log.Printf("Error checking court existence: %v", err)
-		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to verify court: %v", err))
-		return
+		return dbError(err)
 	}
 	if !exists {
 		log.Printf("Court %d not found or inactive", bh.CourtID)
-		sendErrorResponse(w, http.StatusBadRequest, "Court not found or inactive")
-		return
+		return newAppError("COURT_NOT_FOUND", map[string]interface{}{"courtId": bh.CourtID})
 	}
 
 	if bh.Status == "" {
 		bh.Status = "active"
 	}
 
-	query := `INSERT INTO booking_hours (court_id, date_start, date_end, status) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at`
-	err = db.QueryRow(query, bh.CourtID, bh.DateStart, bh.DateEnd, bh.Status).Scan(&bh.ID, &bh.CreatedAt, &bh.UpdatedAt)
+	bh.OwnerID = userFromContext(r).ID
+
+	query := `INSERT INTO booking_hours (court_id, date_start, date_end, status, owner_id) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at`
+	err = db.QueryRow(query, bh.CourtID, bh.DateStart, bh.DateEnd, bh.Status, bh.OwnerID).Scan(&bh.ID, &bh.CreatedAt, &bh.UpdatedAt)
 	if err != nil {
 		log.Printf("Error creating booking hour: %v", err)
-		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create booking hour: %v", err))
-		return
+		return dbError(err)
 	}
 
 	log.Printf("Booking hour created successfully with ID: %d", bh.ID)
@@ -359,109 +465,115 @@ func createBookingHour(w http.ResponseWriter, r *http.Request) {
 		Message: "Booking hour created successfully",
 		Data:    bh,
 	})
+	return nil
 }
 
 // Clip handlers
-func uploadClip(w http.ResponseWriter, r *http.Request) {
+func uploadClip(w http.ResponseWriter, r *http.Request) error {
 	log.Printf("Starting clip upload")
-	
+
 	// Parse multipart form
 	err := r.ParseMultipartForm(100 << 20)
 	if err != nil {
 		log.Printf("Error parsing multipart form: %v", err)
-		sendErrorResponse(w, http.StatusBadRequest, "Failed to parse form")
-		return
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"cause": "failed to parse form"})
 	}
 
 	// Get booking hour ID
 	bookingHourIDStr := r.FormValue("bookingHourId")
 	if bookingHourIDStr == "" {
-		sendErrorResponse(w, http.StatusBadRequest, "Booking hour ID is required")
-		return
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"field": "bookingHourId", "cause": "booking hour ID is required"})
 	}
 
 	bookingHourID, err := strconv.Atoi(bookingHourIDStr)
 	if err != nil {
-		sendErrorResponse(w, http.StatusBadRequest, "Invalid booking hour ID")
-		return
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"field": "bookingHourId", "cause": "invalid booking hour ID"})
 	}
 
 	log.Printf("Upload for booking hour ID: %d", bookingHourID)
 
-	// Verify booking hour exists
-	var exists bool
-	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM booking_hours WHERE id = $1)", bookingHourID).Scan(&exists)
-	if err != nil {
+	// Verify booking hour exists and belongs to the caller
+	var bookingHourOwnerID int
+	err = db.QueryRow("SELECT owner_id FROM booking_hours WHERE id = $1", bookingHourID).Scan(&bookingHourOwnerID)
+	if err == sql.ErrNoRows {
+		log.Printf("Booking hour %d not found", bookingHourID)
+		return newAppError("BOOKING_HOUR_NOT_FOUND", map[string]interface{}{"bookingHourId": bookingHourID})
+	} else if err != nil {
 		log.Printf("Error checking booking hour existence: %v", err)
-		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to verify booking hour: %v", err))
-		return
+		return dbError(err)
 	}
-	if !exists {
-		log.Printf("Booking hour %d not found", bookingHourID)
-		sendErrorResponse(w, http.StatusBadRequest, "Booking hour not found")
-		return
+	if appErr := checkClipOwnership(r, bookingHourOwnerID); appErr != nil {
+		return appErr
 	}
 
 	// Get the uploaded file
 	file, handler, err := r.FormFile("video")
 	if err != nil {
 		log.Printf("Error getting uploaded file: %v", err)
-		sendErrorResponse(w, http.StatusBadRequest, "No video file provided")
-		return
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"field": "video", "cause": "no video file provided"})
 	}
 	defer file.Close()
 
 	log.Printf("Received file: %s, size: %d bytes", handler.Filename, handler.Size)
 
-	// Create upload directory if it doesn't exist
+	// Create upload directories if they don't exist
 	config := loadConfig()
-	uploadDir := filepath.Join(config.UploadDir, "clips")
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		log.Printf("Error creating upload directory: %v", err)
-		sendErrorResponse(w, http.StatusInternalServerError, "Failed to create upload directory")
-		return
+	tmpDir := filepath.Join(config.UploadDir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		log.Printf("Error creating tmp directory: %v", err)
+		return newAppError("INTERNAL_ERROR", map[string]interface{}{"cause": "failed to create upload directory"})
 	}
 
-	// Generate unique filename
-	timestamp := time.Now().Format("20060102_150405")
+	// Stream to a temp file while hashing, since the final content-addressed
+	// path isn't known until the upload finishes.
 	ext := filepath.Ext(handler.Filename)
-	filename := fmt.Sprintf("clip_%d_%s%s", bookingHourID, timestamp, ext)
-	filePath := filepath.Join(uploadDir, filename)
-
-	log.Printf("Saving file to: %s", filePath)
+	timestamp := time.Now().Format("20060102_150405")
+	tmpPath := filepath.Join(tmpDir, fmt.Sprintf("legacy_%s%s", timestamp, ext))
 
-	// Save file
-	dst, err := os.Create(filePath)
+	dst, err := os.Create(tmpPath)
 	if err != nil {
 		log.Printf("Error creating file: %v", err)
-		sendErrorResponse(w, http.StatusInternalServerError, "Failed to save file")
-		return
+		return newAppError("INTERNAL_ERROR", map[string]interface{}{"cause": "failed to save file"})
 	}
-	defer dst.Close()
 
-	fileSize, err := io.Copy(dst, file)
+	hasher := sha256.New()
+	fileSize, err := io.Copy(io.MultiWriter(dst, hasher), file)
+	dst.Close()
 	if err != nil {
 		log.Printf("Error saving file: %v", err)
-		sendErrorResponse(w, http.StatusInternalServerError, "Failed to save file")
-		return
+		os.Remove(tmpPath)
+		return newAppError("INTERNAL_ERROR", map[string]interface{}{"cause": "failed to save file"})
 	}
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
 
-	log.Printf("File saved successfully, size: %d bytes", fileSize)
+	if existing, err := findClipByContentHash(contentHash, userFromContext(r)); err != nil {
+		log.Printf("Error checking for duplicate clip: %v", err)
+		os.Remove(tmpPath)
+		return dbError(err)
+	} else if existing != nil {
+		os.Remove(tmpPath)
+		sendDuplicateClipResponse(w, existing)
+		return nil
+	}
+
+	filePath := contentAddressedPath(config, contentHash, ext)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		log.Printf("Error creating content-addressed directory: %v", err)
+		os.Remove(tmpPath)
+		return newAppError("INTERNAL_ERROR", map[string]interface{}{"cause": "failed to save file"})
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		log.Printf("Error moving file into place: %v", err)
+		os.Remove(tmpPath)
+		return newAppError("INTERNAL_ERROR", map[string]interface{}{"cause": "failed to save file"})
+	}
+
+	log.Printf("File saved successfully, size: %d bytes, hash: %s", fileSize, contentHash)
 
 	// Get MIME type
 	mimeType := handler.Header.Get("Content-Type")
 	if mimeType == "" {
-		// Detect MIME type based on extension
-		switch strings.ToLower(ext) {
-		case ".mp4":
-			mimeType = "video/mp4"
-		case ".avi":
-			mimeType = "video/x-msvideo"
-		case ".webm":
-			mimeType = "video/webm"
-		default:
-			mimeType = "video/mp4"
-		}
+		mimeType = detectMimeType(ext)
 	}
 
 	// Get additional metadata from form
@@ -480,64 +592,120 @@ func uploadClip(w http.ResponseWriter, r *http.Request) {
 	// Save clip metadata to database
 	clip := Clip{
 		BookingHourID: bookingHourID,
-		Filename:      filename,
+		Filename:      handler.Filename,
 		FilePath:      filePath,
 		FileSize:      &fileSize,
 		MimeType:      &mimeType,
 		UploadStatus:  "uploaded",
+		OwnerID:       userFromContext(r).ID,
+		ContentHash:   &contentHash,
 	}
 
 	if cameraName != "" {
 		clip.CameraName = &cameraName
 	}
 
-	query := `INSERT INTO clips (booking_hour_id, filename, file_path, file_size, mime_type, camera_name, upload_status) 
-			  VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, updated_at`
-	err = db.QueryRow(query, clip.BookingHourID, clip.Filename, clip.FilePath, clip.FileSize, clip.MimeType, clip.CameraName, clip.UploadStatus).
+	query := `INSERT INTO clips (booking_hour_id, filename, file_path, file_size, mime_type, camera_name, upload_status, owner_id, content_hash)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at, updated_at`
+	err = db.QueryRow(query, clip.BookingHourID, clip.Filename, clip.FilePath, clip.FileSize, clip.MimeType, clip.CameraName, clip.UploadStatus, clip.OwnerID, clip.ContentHash).
 		Scan(&clip.ID, &clip.CreatedAt, &clip.UpdatedAt)
 	if err != nil {
+		// The dedup lookup above is scoped to the caller's own clips, so it
+		// can miss a match owned by another tenant; the table's unique
+		// constraint on content_hash is the backstop that catches it here.
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			// filePath is the shared content-addressed blob, not something
+			// owned by this request: it's either this caller's own
+			// harmless orphaned write, or another tenant's still-live clip
+			// pointing at it. Leave it on disk either way.
+			log.Printf("Duplicate content hash on upload for booking hour %d", bookingHourID)
+			return newAppError("CLIP_DUPLICATE", map[string]interface{}{"contentHash": contentHash})
+		}
 		log.Printf("Error saving clip metadata: %v", err)
-		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save clip metadata: %v", err))
-		return
+		return dbError(err)
 	}
 
 	log.Printf("Clip uploaded successfully with ID: %d", clip.ID)
 
+	enqueuePackaging(clip.ID)
+
 	sendJSONResponse(w, http.StatusCreated, APIResponse{
 		Success: true,
 		Message: "Clip uploaded successfully",
 		Data:    clip,
 	})
+	return nil
 }
 
-func getClips(w http.ResponseWriter, r *http.Request) {
+var clipSortColumns = map[string]bool{"created_at": true, "duration_seconds": true}
+
+func getClips(w http.ResponseWriter, r *http.Request) error {
 	bookingHourIDStr := r.URL.Query().Get("bookingHourId")
 	log.Printf("Getting clips with booking hour ID filter: '%s'", bookingHourIDStr)
-	
-	var query string
+
+	user := userFromContext(r)
+
+	page, pageSize, err := parsePageParams(r)
+	if err != nil {
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"cause": err.Error()})
+	}
+	sortCol, order, err := parseSortParams(r, clipSortColumns, "created_at", "desc")
+	if err != nil {
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"cause": err.Error()})
+	}
+	from, to, err := parseTimeRangeParams(r)
+	if err != nil {
+		return newAppError("VALIDATION_FAILED", map[string]interface{}{"cause": err.Error()})
+	}
+
+	conditions := []string{}
 	var args []interface{}
-	
+
 	if bookingHourIDStr != "" {
 		bookingHourID, err := strconv.Atoi(bookingHourIDStr)
 		if err != nil {
-			sendErrorResponse(w, http.StatusBadRequest, "Invalid booking hour ID")
-			return
+			return newAppError("VALIDATION_FAILED", map[string]interface{}{"field": "bookingHourId", "cause": "invalid booking hour ID"})
 		}
-		query = `SELECT id, booking_hour_id, filename, file_path, file_size, mime_type, 
-				 duration_seconds, camera_name, upload_status, created_at, updated_at 
-				 FROM clips WHERE booking_hour_id = $1 ORDER BY created_at DESC`
 		args = append(args, bookingHourID)
-	} else {
-		query = `SELECT id, booking_hour_id, filename, file_path, file_size, mime_type, 
-				 duration_seconds, camera_name, upload_status, created_at, updated_at 
-				 FROM clips ORDER BY created_at DESC`
+		conditions = append(conditions, fmt.Sprintf("booking_hour_id = $%d", len(args)))
+	}
+
+	if user.Role != RoleAdmin {
+		args = append(args, user.ID)
+		conditions = append(conditions, fmt.Sprintf("owner_id = $%d", len(args)))
+	}
+
+	if from != nil {
+		args = append(args, *from)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if to != nil {
+		args = append(args, *to)
+		conditions = append(conditions, fmt.Sprintf("created_at <= $%d", len(args)))
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM clips"+whereClause, args...).Scan(&total); err != nil {
+		log.Printf("Error counting clips: %v", err)
+		return dbError(err)
 	}
 
+	query := fmt.Sprintf(`SELECT id, booking_hour_id, filename, file_path, file_size, mime_type,
+			  duration_seconds, camera_name, upload_status, owner_id, content_hash, created_at, updated_at
+			  FROM clips%s ORDER BY %s %s LIMIT $%d OFFSET $%d`,
+		whereClause, sortCol, order, len(args)+1, len(args)+2,
+	)
+	args = append(args, pageSize, (page-1)*pageSize)
+
 	rows, err := db.Query(query, args...)
 	if err != nil {
 		log.Printf("Error querying clips: %v", err)
-		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch clips: %v", err))
-		return
+		return dbError(err)
 	}
 	defer rows.Close()
 
@@ -546,7 +714,7 @@ func getClips(w http.ResponseWriter, r *http.Request) {
 		var clip Clip
 		err := rows.Scan(&clip.ID, &clip.BookingHourID, &clip.Filename, &clip.FilePath,
 			&clip.FileSize, &clip.MimeType, &clip.Duration, &clip.CameraName,
-			&clip.UploadStatus, &clip.CreatedAt, &clip.UpdatedAt)
+			&clip.UploadStatus, &clip.OwnerID, &clip.ContentHash, &clip.CreatedAt, &clip.UpdatedAt)
 		if err != nil {
 			log.Printf("Error scanning clip: %v", err)
 			continue
@@ -554,13 +722,17 @@ func getClips(w http.ResponseWriter, r *http.Request) {
 		clips = append(clips, clip)
 	}
 
-	log.Printf("Found %d clips", len(clips))
+	log.Printf("Found %d clips (page %d of %d total)", len(clips), page, total)
+
+	hasMore := page*pageSize < total
+	setPaginationLinkHeader(w, r, page, pageSize, hasMore)
 
 	sendJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
 		Message: fmt.Sprintf("Clips retrieved successfully (%d found)", len(clips)),
-		Data:    clips,
+		Data:    PagedData{Items: clips, Page: page, PageSize: pageSize, Total: total, HasMore: hasMore},
 	})
+	return nil
 }
 
 // Health check
@@ -605,8 +777,9 @@ func main() {
 	// Create router
 	router := mux.NewRouter()
 
-	// Add logging middleware
+	// Add logging and auth middleware
 	router.Use(loggingMiddleware)
+	router.Use(authMiddleware)
 
 	// API routes
 	api := router.PathPrefix("/api/v1").Subrouter()
@@ -614,21 +787,46 @@ func main() {
 	// Health check
 	api.HandleFunc("/health", healthCheck).Methods("GET")
 
+	// Auth routes
+	api.HandleFunc("/auth/register", register).Methods("POST")
+	api.HandleFunc("/auth/login", login).Methods("POST")
+
 	// Court routes
-	api.HandleFunc("/courts", getCourts).Methods("GET")
-	api.HandleFunc("/courts", createCourt).Methods("POST")
+	api.HandleFunc("/courts", requireRole(RoleViewer, handle(getCourts))).Methods("GET")
+	api.HandleFunc("/courts", requireRole(RoleAdmin, handle(createCourt))).Methods("POST")
 
 	// Booking hour routes
-	api.HandleFunc("/booking-hours", getBookingHours).Methods("GET")
-	api.HandleFunc("/booking-hours", createBookingHour).Methods("POST")
+	api.HandleFunc("/booking-hours", requireRole(RoleViewer, handle(getBookingHours))).Methods("GET")
+	api.HandleFunc("/booking-hours", requireRole(RoleOperator, handle(createBookingHour))).Methods("POST")
 
 	// Clip routes
-	api.HandleFunc("/clips", uploadClip).Methods("POST")
-	api.HandleFunc("/clips", getClips).Methods("GET")
-
-	// Setup CORS
+	api.HandleFunc("/clips", requireRole(RoleOperator, handle(uploadClip))).Methods("POST")
+	api.HandleFunc("/clips", requireRole(RoleViewer, handle(getClips))).Methods("GET")
+
+	// Resumable clip upload routes
+	api.HandleFunc("/clips/init", requireRole(RoleOperator, initClipUpload)).Methods("POST")
+	api.HandleFunc("/clips/chunk", requireRole(RoleOperator, uploadClipChunk)).Methods("POST")
+	api.HandleFunc("/clips/complete", requireRole(RoleOperator, completeClipUpload)).Methods("POST")
+	api.HandleFunc("/clips/status", requireRole(RoleOperator, getClipUploadStatus)).Methods("GET")
+
+	// Packaging/streaming routes
+	api.HandleFunc("/clips/{id:[0-9]+}/manifest.mpd", requireRole(RoleViewer, getClipManifest)).Methods("GET")
+	api.HandleFunc("/clips/{id:[0-9]+}/master.m3u8", requireRole(RoleViewer, getClipMasterPlaylist)).Methods("GET")
+	api.HandleFunc("/clips/{id:[0-9]+}/segments/{name}", requireRole(RoleViewer, getClipSegment)).Methods("GET")
+	api.HandleFunc("/clips/{id:[0-9]+}/verify", requireRole(RoleOperator, getClipVerify)).Methods("GET")
+
+	// Start background sweeper for abandoned upload sessions
+	go sweepAbandonedUploads(config)
+
+	// Start CMAF packaging worker pool
+	startPackagingWorkers(config, config.PackagingWorkers)
+
+	// Setup CORS. Auth rides on an HTTP-only cookie, so the origin allowlist
+	// must be a real list (ALLOWED_ORIGINS, comma-separated) rather than "*"
+	// -- rs/cors reflects the request Origin when AllowCredentials is set,
+	// and a wildcard list would let any site ride a logged-in user's cookie.
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
+		AllowedOrigins:   config.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
 		AllowCredentials: true,
@@ -644,8 +842,8 @@ func main() {
 	log.Printf("  Courts: GET/POST /api/v1/courts")
 	log.Printf("  Booking Hours: GET/POST /api/v1/booking-hours")
 	log.Printf("  Clips: GET/POST /api/v1/clips")
-	
+
 	if err := http.ListenAndServe(":"+config.ServerPort, handler); err != nil {
 		log.Fatal("Server failed to start:", err)
 	}
-}
\ No newline at end of file
+}
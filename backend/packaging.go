@@ -0,0 +1,487 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/gorilla/mux"
+)
+
+// ClipRendition describes the packaged CMAF output for a clip: one init
+// segment plus one media segment, since CCTV clips are short enough that
+// multi-segment splitting isn't needed yet.
+type ClipRendition struct {
+	ID              int       `json:"id"`
+	ClipID          int       `json:"clip_id"`
+	SegmentCount    int       `json:"segment_count"`
+	DurationSeconds int       `json:"duration_seconds"`
+	Codec           string    `json:"codec"`
+	Width           int       `json:"width"`
+	Height          int       `json:"height"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+const (
+	initSegmentName  = "init.mp4"
+	mediaSegmentName = "media_1.m4s"
+)
+
+// packagingJobs is the queue of clip IDs awaiting CMAF packaging. It is
+// drained by a small worker pool so packaging never blocks the upload
+// response.
+var packagingJobs chan int
+
+// startPackagingWorkers launches the configured number of packaging workers.
+func startPackagingWorkers(config *Config, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	packagingJobs = make(chan int, 100)
+	for i := 0; i < concurrency; i++ {
+		go packagingWorker(config)
+	}
+}
+
+func packagingWorker(config *Config) {
+	for clipID := range packagingJobs {
+		packageClipSafely(config, clipID)
+	}
+}
+
+// packageClipSafely runs packageClip with panic recovery. Malformed MP4s can
+// carry a sample table whose offsets/sizes don't match the actual mdat
+// length, and since this isn't an http.Handler goroutine, net/http's
+// per-request recovery doesn't apply — an unrecovered panic here would take
+// down the whole process for every tenant over a single bad upload.
+func packageClipSafely(config *Config, clipID int) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Packaging worker: panic packaging clip %d: %v", clipID, r)
+		}
+	}()
+	if err := packageClip(config, clipID); err != nil {
+		log.Printf("Packaging worker: failed to package clip %d: %v", clipID, err)
+	}
+}
+
+// enqueuePackaging schedules a clip for CMAF packaging without blocking the
+// caller. It is safe to call before the worker pool has started in tests.
+func enqueuePackaging(clipID int) {
+	if packagingJobs == nil {
+		return
+	}
+	select {
+	case packagingJobs <- clipID:
+	default:
+		log.Printf("Packaging queue full, dropping job for clip %d", clipID)
+	}
+}
+
+func renditionDir(config *Config, clipID int) string {
+	return filepath.Join(config.UploadDir, "clips", "renditions", strconv.Itoa(clipID))
+}
+
+// packageClip fragments a stored MP4 into a CMAF init segment and a single
+// media segment, updates clips.duration_seconds from the parsed mvhd box,
+// and records the rendition in clip_renditions. It is idempotent: calling it
+// again for a clip that already has a rendition just re-packages it.
+func packageClip(config *Config, clipID int) error {
+	var filePath string
+	err := db.QueryRow("SELECT file_path FROM clips WHERE id = $1", clipID).Scan(&filePath)
+	if err != nil {
+		return fmt.Errorf("load clip %d: %w", clipID, err)
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("open clip file: %w", err)
+	}
+	defer f.Close()
+
+	parsed, err := mp4.DecodeFile(f)
+	if err != nil {
+		return fmt.Errorf("decode mp4: %w", err)
+	}
+	if parsed.Moov == nil {
+		return fmt.Errorf("clip %d has no moov box", clipID)
+	}
+
+	durationSeconds := 0
+	if parsed.Moov.Mvhd.Timescale > 0 {
+		durationSeconds = int(parsed.Moov.Mvhd.Duration / uint64(parsed.Moov.Mvhd.Timescale))
+	}
+
+	outDir := renditionDir(config, clipID)
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return fmt.Errorf("create rendition dir: %w", err)
+	}
+
+	codec, width, height, err := packageTracks(parsed, outDir)
+	if err != nil {
+		return fmt.Errorf("package tracks: %w", err)
+	}
+
+	_, err = db.Exec("UPDATE clips SET duration_seconds = $1, updated_at = NOW() WHERE id = $2", durationSeconds, clipID)
+	if err != nil {
+		return fmt.Errorf("update clip duration: %w", err)
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO clip_renditions (clip_id, segment_count, duration_seconds, codec, width, height)
+		 VALUES ($1, 1, $2, $3, $4, $5)
+		 ON CONFLICT (clip_id) DO UPDATE SET
+		   segment_count = EXCLUDED.segment_count,
+		   duration_seconds = EXCLUDED.duration_seconds,
+		   codec = EXCLUDED.codec,
+		   width = EXCLUDED.width,
+		   height = EXCLUDED.height`,
+		clipID, durationSeconds, codec, width, height,
+	)
+	if err != nil {
+		return fmt.Errorf("save clip rendition: %w", err)
+	}
+
+	log.Printf("Packaged clip %d into CMAF (%s, %dx%d, %ds)", clipID, codec, width, height, durationSeconds)
+	return nil
+}
+
+// packageTracks builds a muxed CMAF init segment plus a single media segment
+// containing every sample of every video and audio track, and writes both to
+// outDir. Tracks of any other handler type are left out.
+func packageTracks(parsed *mp4.File, outDir string) (codec string, width, height int, err error) {
+	init := mp4.CreateEmptyInit()
+	init.Moov.Mvex.AddChild(&mp4.MehdBox{FragmentDuration: int64(parsed.Moov.Mvhd.Duration)})
+
+	trackIDs := make([]uint32, 0, len(parsed.Moov.Traks))
+	type trackSamples struct {
+		trackID uint32
+		samples []mp4.FullSample
+	}
+	var allSamples []trackSamples
+
+	for _, trak := range parsed.Moov.Traks {
+		var mediaType string
+		switch trak.Mdia.Hdlr.HandlerType {
+		case "vide":
+			mediaType = "video"
+		case "soun":
+			mediaType = "audio"
+		default:
+			continue
+		}
+
+		outTrak := init.AddEmptyTrack(trak.Mdia.Mdhd.Timescale, mediaType, trak.Mdia.Mdhd.GetLanguage())
+		inStsd := trak.Mdia.Minf.Stbl.Stsd
+		outStsd := outTrak.Mdia.Minf.Stbl.Stsd
+
+		switch mediaType {
+		case "video":
+			if inStsd.AvcX != nil {
+				outStsd.AddChild(inStsd.AvcX)
+				codec = "avc1"
+			} else if inStsd.HvcX != nil {
+				outStsd.AddChild(inStsd.HvcX)
+				codec = "hvc1"
+			}
+			width = int(trak.Tkhd.Width) >> 16
+			height = int(trak.Tkhd.Height) >> 16
+		case "audio":
+			if inStsd.Mp4a != nil {
+				outStsd.AddChild(inStsd.Mp4a)
+			}
+		}
+
+		samples, serr := fullSamplesForTrak(parsed, trak)
+		if serr != nil {
+			return "", 0, 0, fmt.Errorf("extract samples for track %d: %w", trak.Tkhd.TrackID, serr)
+		}
+
+		trackIDs = append(trackIDs, outTrak.Tkhd.TrackID)
+		allSamples = append(allSamples, trackSamples{trackID: outTrak.Tkhd.TrackID, samples: samples})
+	}
+
+	if err := mp4.WriteToFile(init, filepath.Join(outDir, initSegmentName)); err != nil {
+		return "", 0, 0, fmt.Errorf("write init segment: %w", err)
+	}
+
+	frag, err := mp4.CreateMultiTrackFragment(1, trackIDs)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("create fragment: %w", err)
+	}
+	for _, ts := range allSamples {
+		for _, sample := range ts.samples {
+			if err := frag.AddFullSampleToTrack(sample, ts.trackID); err != nil {
+				return "", 0, 0, fmt.Errorf("add sample to track %d: %w", ts.trackID, err)
+			}
+		}
+	}
+
+	seg := mp4.NewMediaSegment()
+	seg.AddFragment(frag)
+	if err := mp4.WriteToFile(seg, filepath.Join(outDir, mediaSegmentName)); err != nil {
+		return "", 0, 0, fmt.Errorf("write media segment: %w", err)
+	}
+
+	return codec, width, height, nil
+}
+
+// fullSamplesForTrak reads every sample of trak out of the (eagerly loaded)
+// mdat box, mirroring the extraction mp4ff's own segmenter example performs
+// for a sample range, but over the whole track.
+func fullSamplesForTrak(parsed *mp4.File, trak *mp4.TrakBox) ([]mp4.FullSample, error) {
+	stbl := trak.Mdia.Minf.Stbl
+	sampleCount := stbl.Stsz.SampleNumber
+	samples := make([]mp4.FullSample, 0, sampleCount)
+	mdatPayloadStart := parsed.Mdat.PayloadAbsoluteOffset()
+
+	for sampleNr := uint32(1); sampleNr <= sampleCount; sampleNr++ {
+		chunkNr, sampleNrAtChunkStart, err := stbl.Stsc.ChunkNrFromSampleNr(int(sampleNr))
+		if err != nil {
+			return nil, err
+		}
+
+		var offset int64
+		if stbl.Stco != nil {
+			offset = int64(stbl.Stco.ChunkOffset[chunkNr-1])
+		} else if stbl.Co64 != nil {
+			offset = int64(stbl.Co64.ChunkOffset[chunkNr-1])
+		}
+		for sNr := sampleNrAtChunkStart; sNr < int(sampleNr); sNr++ {
+			offset += int64(stbl.Stsz.GetSampleSize(sNr))
+		}
+
+		size := stbl.Stsz.GetSampleSize(int(sampleNr))
+		decTime, dur := stbl.Stts.GetDecodeTime(sampleNr)
+		var cto int32
+		if stbl.Ctts != nil {
+			cto = stbl.Ctts.GetCompositionTimeOffset(sampleNr)
+		}
+
+		var flags mp4.SampleFlags
+		if stbl.Stss != nil {
+			isSync := stbl.Stss.IsSyncSample(sampleNr)
+			flags.SampleIsNonSync = !isSync
+			if isSync {
+				flags.SampleDependsOn = 2
+			}
+		}
+
+		offsetInMdat := uint64(offset) - mdatPayloadStart
+		data := parsed.Mdat.Data[offsetInMdat : offsetInMdat+uint64(size)]
+
+		samples = append(samples, mp4.FullSample{
+			Sample: mp4.Sample{
+				Flags:                 flags.Encode(),
+				Size:                  size,
+				Dur:                   dur,
+				CompositionTimeOffset: cto,
+			},
+			DecodeTime: decTime,
+			Data:       data,
+		})
+	}
+	return samples, nil
+}
+
+func clipIDFromRequest(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["id"])
+}
+
+func loadClipForPackaging(clipID int) (*Clip, *ClipRendition, error) {
+	var clip Clip
+	err := db.QueryRow(
+		`SELECT id, booking_hour_id, filename, file_path, file_size, mime_type,
+		        duration_seconds, camera_name, upload_status, owner_id, content_hash, created_at, updated_at
+		 FROM clips WHERE id = $1`,
+		clipID,
+	).Scan(&clip.ID, &clip.BookingHourID, &clip.Filename, &clip.FilePath, &clip.FileSize, &clip.MimeType,
+		&clip.Duration, &clip.CameraName, &clip.UploadStatus, &clip.OwnerID, &clip.ContentHash, &clip.CreatedAt, &clip.UpdatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rendition ClipRendition
+	err = db.QueryRow(
+		`SELECT id, clip_id, segment_count, duration_seconds, codec, width, height, created_at
+		 FROM clip_renditions WHERE clip_id = $1`,
+		clipID,
+	).Scan(&rendition.ID, &rendition.ClipID, &rendition.SegmentCount, &rendition.DurationSeconds,
+		&rendition.Codec, &rendition.Width, &rendition.Height, &rendition.CreatedAt)
+	if err != nil {
+		return &clip, nil, nil
+	}
+	return &clip, &rendition, nil
+}
+
+// ensurePackaged packages a clip on demand if it hasn't been packaged yet,
+// so the first manifest/playlist request for an older clip still works.
+func ensurePackaged(config *Config, clipID int) (*ClipRendition, error) {
+	_, rendition, err := loadClipForPackaging(clipID)
+	if err != nil {
+		return nil, err
+	}
+	if rendition != nil {
+		return rendition, nil
+	}
+	if err := packageClip(config, clipID); err != nil {
+		return nil, err
+	}
+	_, rendition, err = loadClipForPackaging(clipID)
+	if err != nil {
+		return nil, err
+	}
+	return rendition, nil
+}
+
+// getClipManifest serves a DASH MPD for the clip's single CMAF rendition.
+func getClipManifest(w http.ResponseWriter, r *http.Request) {
+	clipID, err := clipIDFromRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid clip ID")
+		return
+	}
+
+	clip, _, err := loadClipForPackaging(clipID)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, http.StatusNotFound, "Clip not found")
+		return
+	} else if err != nil {
+		log.Printf("Error loading clip %d: %v", clipID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to load clip")
+		return
+	}
+	if appErr := checkClipOwnership(r, clip.OwnerID); appErr != nil {
+		sendAppError(w, appErr)
+		return
+	}
+
+	config := loadConfig()
+	rendition, err := ensurePackaged(config, clipID)
+	if err != nil {
+		log.Printf("Error packaging clip %d for manifest: %v", clipID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to package clip")
+		return
+	}
+
+	base := fmt.Sprintf("/api/v1/clips/%d/segments", clipID)
+	mpd := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011"
+     type="static" mediaPresentationDuration="PT%dS" minBufferTime="PT2S">
+  <Period>
+    <AdaptationSet mimeType="video/mp4" segmentAlignment="true">
+      <Representation id="1" codecs="%s" width="%d" height="%d" bandwidth="0">
+        <SegmentTemplate initialization="%s/%s" media="%s/%s" startNumber="1" duration="%d" timescale="1"/>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`, rendition.DurationSeconds, rendition.Codec, rendition.Width, rendition.Height,
+		base, initSegmentName, base, mediaSegmentName, rendition.DurationSeconds)
+
+	w.Header().Set("Content-Type", "application/dash+xml")
+	w.Write([]byte(mpd))
+}
+
+// getClipMasterPlaylist serves the HLS playlist for the clip. Since there is
+// currently only a single rendition, this doubles as both the master and the
+// media playlist; a real master (with EXT-X-STREAM-INF variants) will be
+// needed once multiple renditions exist.
+func getClipMasterPlaylist(w http.ResponseWriter, r *http.Request) {
+	clipID, err := clipIDFromRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid clip ID")
+		return
+	}
+
+	clip, _, err := loadClipForPackaging(clipID)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, http.StatusNotFound, "Clip not found")
+		return
+	} else if err != nil {
+		log.Printf("Error loading clip %d: %v", clipID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to load clip")
+		return
+	}
+	if appErr := checkClipOwnership(r, clip.OwnerID); appErr != nil {
+		sendAppError(w, appErr)
+		return
+	}
+
+	config := loadConfig()
+	rendition, err := ensurePackaged(config, clipID)
+	if err != nil {
+		log.Printf("Error packaging clip %d for playlist: %v", clipID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to package clip")
+		return
+	}
+
+	base := fmt.Sprintf("/api/v1/clips/%d/segments", clipID)
+	playlist := fmt.Sprintf(`#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:%d
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MAP:URI="%s/%s"
+#EXTINF:%d,
+%s/%s
+#EXT-X-ENDLIST
+`, rendition.DurationSeconds, base, initSegmentName, rendition.DurationSeconds, base, mediaSegmentName)
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Write([]byte(playlist))
+}
+
+// getClipSegment streams a packaged CMAF init or media segment from disk,
+// supporting HTTP Range requests via http.ServeContent.
+func getClipSegment(w http.ResponseWriter, r *http.Request) {
+	clipID, err := clipIDFromRequest(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid clip ID")
+		return
+	}
+
+	clip, _, err := loadClipForPackaging(clipID)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, http.StatusNotFound, "Clip not found")
+		return
+	} else if err != nil {
+		log.Printf("Error loading clip %d: %v", clipID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to load clip")
+		return
+	}
+	if appErr := checkClipOwnership(r, clip.OwnerID); appErr != nil {
+		sendAppError(w, appErr)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	if name != initSegmentName && !strings.HasPrefix(name, "media_") {
+		sendErrorResponse(w, http.StatusBadRequest, "Unknown segment name")
+		return
+	}
+
+	config := loadConfig()
+	path := filepath.Join(renditionDir(config, clipID), filepath.Base(name))
+
+	f, err := os.Open(path)
+	if err != nil {
+		sendErrorResponse(w, http.StatusNotFound, "Segment not found")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to read segment")
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/mp4")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 200
+)
+
+// PagedData is the envelope used by list endpoints so clients can page,
+// sort, and know whether more results are available without recomputing
+// totals themselves.
+type PagedData struct {
+	Items    interface{} `json:"items"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+	Total    int         `json:"total"`
+	HasMore  bool        `json:"hasMore"`
+}
+
+// parsePageParams reads page/pageSize query params, defaulting page to 1 and
+// pageSize to defaultPageSize. A page or pageSize below 1 is an error; a
+// pageSize above maxPageSize is clamped to maxPageSize.
+func parsePageParams(r *http.Request) (page, pageSize int, err error) {
+	page = 1
+	if v := r.URL.Query().Get("page"); v != "" {
+		page, err = strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("invalid page")
+		}
+	}
+
+	pageSize = defaultPageSize
+	if v := r.URL.Query().Get("pageSize"); v != "" {
+		pageSize, err = strconv.Atoi(v)
+		if err != nil || pageSize < 1 {
+			return 0, 0, fmt.Errorf("invalid pageSize")
+		}
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	return page, pageSize, nil
+}
+
+// parseSortParams validates the sort/order query params against a whitelist
+// of column names so they can be interpolated directly into an ORDER BY
+// clause without risking SQL injection.
+func parseSortParams(r *http.Request, allowedColumns map[string]bool, defaultSort, defaultOrder string) (column, order string, err error) {
+	column = defaultSort
+	if v := r.URL.Query().Get("sort"); v != "" {
+		if !allowedColumns[v] {
+			return "", "", fmt.Errorf("invalid sort column: %s", v)
+		}
+		column = v
+	}
+
+	order = defaultOrder
+	if v := r.URL.Query().Get("order"); v != "" {
+		if v != "asc" && v != "desc" {
+			return "", "", fmt.Errorf("invalid order: %s", v)
+		}
+		order = v
+	}
+
+	return column, order, nil
+}
+
+// parseTimeRangeParams reads optional RFC3339 `from`/`to` query params.
+func parseTimeRangeParams(r *http.Request) (from, to *time.Time, err error) {
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid from timestamp")
+		}
+		from = &t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid to timestamp")
+		}
+		to = &t
+	}
+	return from, to, nil
+}
+
+// setPaginationLinkHeader emits rel="next"/rel="prev" Link header entries so
+// paginated clients can navigate without recomputing query strings.
+func setPaginationLinkHeader(w http.ResponseWriter, r *http.Request, page, pageSize int, hasMore bool) {
+	var links []string
+
+	if hasMore {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(r, page+1, pageSize)))
+	}
+	if page > 1 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(r, page-1, pageSize)))
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", joinLinks(links))
+	}
+}
+
+func pageURL(r *http.Request, page, pageSize int) string {
+	q := r.URL.Query()
+	q.Set("page", strconv.Itoa(page))
+	q.Set("pageSize", strconv.Itoa(pageSize))
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	return u.String()
+}
+
+func joinLinks(links []string) string {
+	return strings.Join(links, ", ")
+}
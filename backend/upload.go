@@ -0,0 +1,497 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// UploadSession tracks the progress of a resumable clip upload.
+type UploadSession struct {
+	UploadID      string    `json:"uploadId"`
+	ClipID        int       `json:"clipId"`
+	BookingHourID int       `json:"bookingHourId"`
+	Filename      string    `json:"filename"`
+	TotalSize     int64     `json:"totalSize"`
+	SHA256        string    `json:"sha256"`
+	BytesReceived int64     `json:"bytesReceived"`
+	OwnerID       int       `json:"ownerId"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type initUploadRequest struct {
+	BookingHourID int    `json:"bookingHourId"`
+	Filename      string `json:"filename"`
+	TotalSize     int64  `json:"totalSize"`
+	SHA256        string `json:"sha256"`
+}
+
+// detectMimeType guesses a video MIME type from a file extension.
+func detectMimeType(ext string) string {
+	switch strings.ToLower(ext) {
+	case ".mp4":
+		return "video/mp4"
+	case ".avi":
+		return "video/x-msvideo"
+	case ".webm":
+		return "video/webm"
+	default:
+		return "video/mp4"
+	}
+}
+
+// generateUploadID returns a random hex identifier for a new upload session.
+func generateUploadID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func tmpUploadPath(config *Config, uploadID string) string {
+	return filepath.Join(config.UploadDir, "tmp", uploadID+".part")
+}
+
+// initClipUpload creates a pending clip row and an upload session so the
+// client can start streaming chunks.
+func initClipUpload(w http.ResponseWriter, r *http.Request) {
+	var req initUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error decoding init upload JSON: %v", err)
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload")
+		return
+	}
+
+	if req.BookingHourID == 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "Booking hour ID is required")
+		return
+	}
+	if req.Filename == "" {
+		sendErrorResponse(w, http.StatusBadRequest, "Filename is required")
+		return
+	}
+	if req.TotalSize <= 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "totalSize must be greater than zero")
+		return
+	}
+	if req.SHA256 == "" {
+		sendErrorResponse(w, http.StatusBadRequest, "sha256 is required")
+		return
+	}
+
+	var bookingHourOwnerID int
+	err := db.QueryRow("SELECT owner_id FROM booking_hours WHERE id = $1", req.BookingHourID).Scan(&bookingHourOwnerID)
+	if err == sql.ErrNoRows {
+		sendAppError(w, newAppError("BOOKING_HOUR_NOT_FOUND", map[string]interface{}{"bookingHourId": req.BookingHourID}))
+		return
+	} else if err != nil {
+		log.Printf("Error checking booking hour existence: %v", err)
+		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to verify booking hour: %v", err))
+		return
+	}
+	if appErr := checkClipOwnership(r, bookingHourOwnerID); appErr != nil {
+		sendAppError(w, appErr)
+		return
+	}
+
+	uploadID, err := generateUploadID()
+	if err != nil {
+		log.Printf("Error generating upload ID: %v", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to start upload")
+		return
+	}
+
+	mimeType := detectMimeType(filepath.Ext(req.Filename))
+
+	var clipID int
+	err = db.QueryRow(
+		`INSERT INTO clips (booking_hour_id, filename, file_path, mime_type, upload_status, owner_id)
+		 VALUES ($1, $2, '', $3, 'pending', $4) RETURNING id`,
+		req.BookingHourID, req.Filename, mimeType, userFromContext(r).ID,
+	).Scan(&clipID)
+	if err != nil {
+		log.Printf("Error creating pending clip: %v", err)
+		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create clip: %v", err))
+		return
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO upload_sessions (upload_id, clip_id, booking_hour_id, filename, total_size, sha256, bytes_received)
+		 VALUES ($1, $2, $3, $4, $5, $6, 0)`,
+		uploadID, clipID, req.BookingHourID, req.Filename, req.TotalSize, req.SHA256,
+	)
+	if err != nil {
+		log.Printf("Error creating upload session: %v", err)
+		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create upload session: %v", err))
+		return
+	}
+
+	log.Printf("Upload session %s initialized for clip %d (%d bytes)", uploadID, clipID, req.TotalSize)
+
+	sendJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "Upload session created",
+		Data: map[string]interface{}{
+			"uploadId": uploadID,
+			"clipId":   clipID,
+		},
+	})
+}
+
+// loadUploadSession joins through to the pending clip row for owner_id,
+// since upload_sessions doesn't carry its own ownership column.
+func loadUploadSession(uploadID string) (*UploadSession, error) {
+	var s UploadSession
+	err := db.QueryRow(
+		`SELECT s.upload_id, s.clip_id, s.booking_hour_id, s.filename, s.total_size, s.sha256, s.bytes_received, s.created_at, s.updated_at, c.owner_id
+		 FROM upload_sessions s JOIN clips c ON c.id = s.clip_id WHERE s.upload_id = $1`,
+		uploadID,
+	).Scan(&s.UploadID, &s.ClipID, &s.BookingHourID, &s.Filename, &s.TotalSize, &s.SHA256, &s.BytesReceived, &s.CreatedAt, &s.UpdatedAt, &s.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// uploadClipChunk appends a raw chunk of bytes to the session's temp file.
+// The offset query param must match the current size of that file so retried
+// chunks are idempotent instead of being appended twice.
+func uploadClipChunk(w http.ResponseWriter, r *http.Request) {
+	uploadID := r.URL.Query().Get("uploadId")
+	if uploadID == "" {
+		sendErrorResponse(w, http.StatusBadRequest, "uploadId is required")
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid offset")
+		return
+	}
+
+	session, err := loadUploadSession(uploadID)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, http.StatusNotFound, "Upload session not found")
+		return
+	} else if err != nil {
+		log.Printf("Error loading upload session %s: %v", uploadID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to load upload session")
+		return
+	}
+	if appErr := checkClipOwnership(r, session.OwnerID); appErr != nil {
+		sendAppError(w, appErr)
+		return
+	}
+
+	config := loadConfig()
+	tmpDir := filepath.Join(config.UploadDir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		log.Printf("Error creating tmp directory: %v", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to prepare upload storage")
+		return
+	}
+
+	tmpPath := tmpUploadPath(config, uploadID)
+	var currentSize int64
+	if info, err := os.Stat(tmpPath); err == nil {
+		currentSize = info.Size()
+	} else if !os.IsNotExist(err) {
+		log.Printf("Error stating tmp file %s: %v", tmpPath, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to inspect upload progress")
+		return
+	}
+
+	if offset != currentSize {
+		sendErrorResponse(w, http.StatusConflict, fmt.Sprintf("Offset mismatch: expected %d, got %d", currentSize, offset))
+		return
+	}
+
+	maxAllowed := session.TotalSize - currentSize
+	if r.ContentLength > maxAllowed {
+		sendAppError(w, newAppError("UPLOAD_TOO_LARGE", map[string]interface{}{
+			"currentSize": currentSize, "chunkSize": r.ContentLength, "totalSize": session.TotalSize,
+		}))
+		return
+	}
+
+	f, err := os.OpenFile(tmpPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Error opening tmp file %s: %v", tmpPath, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to save chunk")
+		return
+	}
+	defer f.Close()
+
+	// Content-Length alone isn't trustworthy here: a client that omits it
+	// (e.g. chunked transfer encoding) sends -1, which would make the
+	// precheck above a no-op and let the body grow unbounded. Cap the copy
+	// itself, reading one byte past the limit so an oversized chunk is
+	// detected instead of silently truncated.
+	written, err := io.Copy(f, io.LimitReader(r.Body, maxAllowed+1))
+	if err != nil {
+		log.Printf("Error writing chunk for upload %s: %v", uploadID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to save chunk")
+		return
+	}
+	if written > maxAllowed {
+		f.Close()
+		if err := os.Truncate(tmpPath, currentSize); err != nil {
+			log.Printf("Error truncating oversized chunk for upload %s: %v", uploadID, err)
+		}
+		sendAppError(w, newAppError("UPLOAD_TOO_LARGE", map[string]interface{}{
+			"currentSize": currentSize, "totalSize": session.TotalSize,
+		}))
+		return
+	}
+
+	newSize := currentSize + written
+	_, err = db.Exec(`UPDATE upload_sessions SET bytes_received = $1, updated_at = NOW() WHERE upload_id = $2`, newSize, uploadID)
+	if err != nil {
+		log.Printf("Error updating upload session %s: %v", uploadID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to record chunk progress")
+		return
+	}
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Chunk received",
+		Data: map[string]interface{}{
+			"uploadId":      uploadID,
+			"bytesReceived": newSize,
+			"totalSize":     session.TotalSize,
+		},
+	})
+}
+
+// getClipUploadStatus reports how many bytes have been received so far so a
+// client can resume from the right offset.
+func getClipUploadStatus(w http.ResponseWriter, r *http.Request) {
+	uploadID := r.URL.Query().Get("uploadId")
+	if uploadID == "" {
+		sendErrorResponse(w, http.StatusBadRequest, "uploadId is required")
+		return
+	}
+
+	session, err := loadUploadSession(uploadID)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, http.StatusNotFound, "Upload session not found")
+		return
+	} else if err != nil {
+		log.Printf("Error loading upload session %s: %v", uploadID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to load upload session")
+		return
+	}
+	if appErr := checkClipOwnership(r, session.OwnerID); appErr != nil {
+		sendAppError(w, appErr)
+		return
+	}
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Upload status retrieved",
+		Data: map[string]interface{}{
+			"uploadId":      session.UploadID,
+			"bytesReceived": session.BytesReceived,
+			"totalSize":     session.TotalSize,
+		},
+	})
+}
+
+// completeClipUpload verifies the assembled file against the declared
+// checksum, moves it into place, and flips the clip row to uploaded.
+func completeClipUpload(w http.ResponseWriter, r *http.Request) {
+	uploadID := r.URL.Query().Get("uploadId")
+	if uploadID == "" {
+		sendErrorResponse(w, http.StatusBadRequest, "uploadId is required")
+		return
+	}
+
+	session, err := loadUploadSession(uploadID)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, http.StatusNotFound, "Upload session not found")
+		return
+	} else if err != nil {
+		log.Printf("Error loading upload session %s: %v", uploadID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to load upload session")
+		return
+	}
+	if appErr := checkClipOwnership(r, session.OwnerID); appErr != nil {
+		sendAppError(w, appErr)
+		return
+	}
+
+	config := loadConfig()
+	tmpPath := tmpUploadPath(config, uploadID)
+
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		log.Printf("Error stating tmp file %s: %v", tmpPath, err)
+		sendErrorResponse(w, http.StatusBadRequest, "No uploaded data found for this session")
+		return
+	}
+	if info.Size() != session.TotalSize {
+		sendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Upload incomplete: received %d of %d bytes", info.Size(), session.TotalSize))
+		return
+	}
+
+	actualSum, err := hashFile(tmpPath)
+	if err != nil {
+		log.Printf("Error hashing tmp file %s: %v", tmpPath, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to verify upload")
+		return
+	}
+	if !strings.EqualFold(actualSum, session.SHA256) {
+		sendErrorResponse(w, http.StatusBadRequest, "Checksum mismatch")
+		return
+	}
+
+	if existing, err := findClipByContentHash(actualSum, userFromContext(r)); err != nil {
+		log.Printf("Error checking for duplicate clip: %v", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to check for duplicate content")
+		return
+	} else if existing != nil {
+		os.Remove(tmpPath)
+		db.Exec(`DELETE FROM upload_sessions WHERE upload_id = $1`, uploadID)
+		db.Exec(`DELETE FROM clips WHERE id = $1 AND upload_status = 'pending'`, session.ClipID)
+		sendDuplicateClipResponse(w, existing)
+		return
+	}
+
+	ext := filepath.Ext(session.Filename)
+	finalPath := contentAddressedPath(config, actualSum, ext)
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
+		log.Printf("Error creating content-addressed directory: %v", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to finalize upload")
+		return
+	}
+
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		log.Printf("Error moving upload %s into place: %v", uploadID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to finalize upload")
+		return
+	}
+
+	mimeType := detectMimeType(ext)
+
+	var clip Clip
+	err = db.QueryRow(
+		`UPDATE clips SET file_path = $1, file_size = $2, mime_type = $3, content_hash = $4, upload_status = 'uploaded', updated_at = NOW()
+		 WHERE id = $5
+		 RETURNING id, booking_hour_id, filename, file_path, file_size, mime_type, duration_seconds, camera_name, upload_status, owner_id, content_hash, created_at, updated_at`,
+		finalPath, info.Size(), mimeType, actualSum, session.ClipID,
+	).Scan(&clip.ID, &clip.BookingHourID, &clip.Filename, &clip.FilePath, &clip.FileSize, &clip.MimeType,
+		&clip.Duration, &clip.CameraName, &clip.UploadStatus, &clip.OwnerID, &clip.ContentHash, &clip.CreatedAt, &clip.UpdatedAt)
+	if err != nil {
+		// The dedup lookup above is scoped to the caller's own clips, so it
+		// can miss a match owned by another tenant; the table's unique
+		// constraint on content_hash is the backstop that catches it here.
+		// finalPath is the shared content-addressed blob in that case, not
+		// something this request owns - it's either this caller's own
+		// harmless orphaned write, or another tenant's still-live clip
+		// pointing at it, so leave it on disk.
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			log.Printf("Duplicate content hash finalizing upload %s", uploadID)
+			db.Exec(`DELETE FROM upload_sessions WHERE upload_id = $1`, uploadID)
+			db.Exec(`DELETE FROM clips WHERE id = $1 AND upload_status = 'pending'`, session.ClipID)
+			sendAppError(w, newAppError("CLIP_DUPLICATE", map[string]interface{}{"contentHash": actualSum}))
+			return
+		}
+		os.Remove(finalPath)
+		log.Printf("Error finalizing clip %d: %v", session.ClipID, err)
+		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to finalize clip: %v", err))
+		return
+	}
+
+	if _, err := db.Exec(`DELETE FROM upload_sessions WHERE upload_id = $1`, uploadID); err != nil {
+		log.Printf("Error cleaning up upload session %s: %v", uploadID, err)
+	}
+
+	enqueuePackaging(clip.ID)
+
+	log.Printf("Upload %s completed, clip %d finalized at %s", uploadID, clip.ID, finalPath)
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Clip uploaded successfully",
+		Data:    clip,
+	})
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sweepAbandonedUploads periodically deletes upload sessions (and their temp
+// files) that have sat unfinished for longer than the configured max age.
+func sweepAbandonedUploads(config *Config) {
+	ticker := time.NewTicker(config.UploadSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		cutoff := time.Now().Add(-config.UploadSessionMaxAge)
+
+		rows, err := db.Query(`SELECT upload_id, clip_id FROM upload_sessions WHERE created_at < $1`, cutoff)
+		if err != nil {
+			log.Printf("Upload sweeper: error querying stale sessions: %v", err)
+			continue
+		}
+
+		var staleIDs []string
+		var staleClipIDs []int
+		for rows.Next() {
+			var uploadID string
+			var clipID int
+			if err := rows.Scan(&uploadID, &clipID); err != nil {
+				log.Printf("Upload sweeper: error scanning session: %v", err)
+				continue
+			}
+			staleIDs = append(staleIDs, uploadID)
+			staleClipIDs = append(staleClipIDs, clipID)
+		}
+		rows.Close()
+
+		for i, uploadID := range staleIDs {
+			tmpPath := tmpUploadPath(config, uploadID)
+			if err := os.Remove(tmpPath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Upload sweeper: error removing tmp file %s: %v", tmpPath, err)
+			}
+			if _, err := db.Exec(`DELETE FROM upload_sessions WHERE upload_id = $1`, uploadID); err != nil {
+				log.Printf("Upload sweeper: error deleting session %s: %v", uploadID, err)
+				continue
+			}
+			if _, err := db.Exec(`DELETE FROM clips WHERE id = $1 AND upload_status = 'pending'`, staleClipIDs[i]); err != nil {
+				log.Printf("Upload sweeper: error deleting pending clip %d: %v", staleClipIDs[i], err)
+			}
+			log.Printf("Upload sweeper: removed abandoned session %s (clip %d)", uploadID, staleClipIDs[i])
+		}
+
+		if len(staleIDs) > 0 {
+			log.Printf("Upload sweeper: cleaned up %d abandoned session(s)", len(staleIDs))
+		}
+	}
+}